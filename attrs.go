@@ -0,0 +1,88 @@
+package sqlcache
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// queryAttrs holds the cache directives parsed out of a query's SQL comment.
+type queryAttrs struct {
+	ttl     int
+	maxRows int
+	// tag identifies the query for the metrics package's query_tag label.
+	tag string
+	// tags are stamped onto the cached cache.Item so InvalidateByTag can
+	// find it later.
+	tags []string
+	// invalidate lists the tags a write statement should flush once it has
+	// executed successfully.
+	invalidate []string
+}
+
+// hintPattern matches a "/* sqlcache ... */" comment anywhere in the query.
+var hintPattern = regexp.MustCompile(`(?s)/\*\s*sqlcache:?\s*(.*?)\*/`)
+
+// kvPattern matches a single key=value directive inside a hint. getAttrs
+// splits the hint body on commas before matching, so val never itself
+// contains a comma; a comma-separated list of values for tags/invalidate is
+// instead reassembled from the bare continuation tokens that splitting
+// produces (see the listKey handling below).
+var kvPattern = regexp.MustCompile(`(\w+)\s*=\s*(\w+)`)
+
+// getAttrs parses the "/* sqlcache ttl=60,maxRows=1000,tags=t1,t2 */" (reads)
+// or "/* sqlcache invalidate=t1,t2 */" (writes) comment embedded in query,
+// returning nil if the query carries no caching directive. Directives may be
+// separated by commas, whitespace, or both; only tags and invalidate take a
+// comma-separated list of values, so "ttl=60,tags=t1,t2" attaches the bare
+// "t2" segment to the tags list rather than miscounting it as its own
+// directive.
+func getAttrs(query string) *queryAttrs {
+	m := hintPattern.FindStringSubmatch(query)
+	if m == nil {
+		return nil
+	}
+
+	a := &queryAttrs{}
+	listKey := "" // the most recent tags/invalidate key, for comma continuations
+	for _, segment := range strings.Split(m[1], ",") {
+		matches := kvPattern.FindAllStringSubmatch(segment, -1)
+		if len(matches) == 0 {
+			if val := strings.TrimSpace(segment); val != "" {
+				a.appendListValue(listKey, val)
+			}
+			continue
+		}
+
+		for _, kv := range matches {
+			key, val := kv[1], kv[2]
+			listKey = ""
+			switch key {
+			case "ttl":
+				if v, err := strconv.Atoi(val); err == nil {
+					a.ttl = v
+				}
+			case "maxRows":
+				if v, err := strconv.Atoi(val); err == nil {
+					a.maxRows = v
+				}
+			case "tag":
+				a.tag = val
+			case "tags", "invalidate":
+				a.appendListValue(key, val)
+				listKey = key
+			}
+		}
+	}
+	return a
+}
+
+// appendListValue appends val to the tags or invalidate list named by key.
+func (a *queryAttrs) appendListValue(key, val string) {
+	switch key {
+	case "tags":
+		a.tags = append(a.tags, val)
+	case "invalidate":
+		a.invalidate = append(a.invalidate, val)
+	}
+}
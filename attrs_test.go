@@ -0,0 +1,69 @@
+package sqlcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAttrs(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		want  *queryAttrs
+	}{
+		{
+			name:  "no hint",
+			query: "select 1",
+			want:  nil,
+		},
+		{
+			name:  "comma-separated ttl and maxRows",
+			query: "/* sqlcache ttl=60,maxRows=1000 */ select 1",
+			want:  &queryAttrs{ttl: 60, maxRows: 1000},
+		},
+		{
+			name:  "space-separated ttl and maxRows",
+			query: "/* sqlcache ttl=60 maxRows=1000 */ select 1",
+			want:  &queryAttrs{ttl: 60, maxRows: 1000},
+		},
+		{
+			name:  "single-value tags list",
+			query: "/* sqlcache tags=t1 */ select 1",
+			want:  &queryAttrs{tags: []string{"t1"}},
+		},
+		{
+			// Regression: ttl's value must not swallow the following
+			// directive, and tags must still come through as a full list.
+			name:  "ttl combined with a multi-value tags list",
+			query: "/* sqlcache ttl=60,tags=t1,t2 */ select 1",
+			want:  &queryAttrs{ttl: 60, tags: []string{"t1", "t2"}},
+		},
+		{
+			name:  "ttl, maxRows, tag and a multi-value tags list all combined",
+			query: "/* sqlcache ttl=60,maxRows=1000,tag=users,tags=t1,t2,t3 */ select 1",
+			want:  &queryAttrs{ttl: 60, maxRows: 1000, tag: "users", tags: []string{"t1", "t2", "t3"}},
+		},
+		{
+			name:  "invalidate list on its own",
+			query: "/* sqlcache invalidate=t1,t2 */ delete from foo",
+			want:  &queryAttrs{invalidate: []string{"t1", "t2"}},
+		},
+		{
+			name:  "maxRows combined with an invalidate list",
+			query: "/* sqlcache maxRows=1000,invalidate=t1,t2 */ select 1",
+			want:  &queryAttrs{maxRows: 1000, invalidate: []string{"t1", "t2"}},
+		},
+		{
+			name:  "both tags and invalidate lists in one hint",
+			query: "/* sqlcache tags=t1,t2,invalidate=x1,x2 */ select 1",
+			want:  &queryAttrs{tags: []string{"t1", "t2"}, invalidate: []string{"x1", "x2"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, getAttrs(tc.query))
+		})
+	}
+}
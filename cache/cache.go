@@ -0,0 +1,39 @@
+// Package cache defines the storage abstraction used by sqlcache and a
+// handful of composable implementations on top of it: Chain for tiering
+// stores, MemoryCache as a real (if in-process-only) Cacher, and CodecCache
+// for adapting a byte-oriented store into one. A shared L2 such as Redis is
+// a Cacher a caller plugs in themselves; none ships from this package since
+// it would pull in a client library this module doesn't otherwise depend on.
+package cache
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// Item is a cached row set together with the column metadata needed to
+// reconstruct a driver.Rows implementation from it, plus the tags it was
+// stored under for later invalidation.
+type Item struct {
+	Cols []string
+	Rows [][]driver.Value
+	Tags []string
+}
+
+// Cacher is implemented by cache backends plugged into sqlcache.Interceptor
+// via Config.Cache. Get also reports the remaining TTL of the entry so that
+// callers composing several Cachers (see Chain) can back-fill faster tiers
+// without outliving the original entry, plus a tier label identifying which
+// backend actually served the hit (e.g. for a hit-rate metric broken down
+// by tier); a single-backend Cacher can return a fixed label, while Chain
+// passes through whichever of its stores served the request.
+type Cacher interface {
+	Get(key string) (item *Item, ttl time.Duration, tier string, ok bool, err error)
+	Set(key string, item *Item, ttl time.Duration) error
+	// Delete removes a single entry from the store. It is not an error to
+	// delete a key that isn't present.
+	Delete(key string) error
+	// InvalidateByTag removes every entry stored with the given tag (see
+	// Item.Tags).
+	InvalidateByTag(tag string) error
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultFanoutTimeout bounds how long Set waits on a single store before
+// giving up on it, when Chain.FanoutTimeout is left unset.
+const defaultFanoutTimeout = 500 * time.Millisecond
+
+// Chain composes several Cacher stores into a single tiered cache, consulting
+// them in priority order (e.g. an in-process L1 ahead of a shared L2 such as
+// Redis). Get walks the stores top-down and returns on the first hit,
+// back-filling the faster tiers it skipped over with the remaining TTL. Set
+// fans out to every store concurrently, isolating a slow or failing store
+// from the rest via FanoutTimeout and OnError.
+type Chain struct {
+	stores []Cacher
+
+	// FanoutTimeout bounds how long Set waits on each store. Defaults to
+	// 500ms if zero.
+	FanoutTimeout time.Duration
+	// OnError is invoked for every per-store error encountered during Get
+	// back-fill or Set fanout. It never stops the chain from proceeding.
+	OnError func(err error)
+
+	// tagIndex tracks, for every tag a cached Item was written with, the set
+	// of keys currently stored under it, so InvalidateByTag can be served
+	// without support from the underlying stores. keyTags is tagIndex's
+	// reverse mapping, letting Delete and a Get that discovers a key has
+	// expired out of every store prune both sides instead of leaking
+	// entries for keys that are no longer cached anywhere.
+	tagIndex sync.Map // tag string -> *sync.Map (key string -> struct{})
+	keyTags  sync.Map // key string -> []string
+}
+
+// NewChain returns a Chain that consults stores in the given order, fastest
+// tier first.
+func NewChain(stores ...Cacher) *Chain {
+	return &Chain{stores: stores}
+}
+
+// Get walks the chain's stores top-down, returning the first hit and
+// back-filling the stores it skipped over with the remaining TTL. The tier
+// label is whichever store served the hit, passed through as-is, so a
+// hit-rate metric keyed on it reflects which tier is actually absorbing
+// traffic instead of a single label for the whole Chain.
+func (c *Chain) Get(key string) (*Item, time.Duration, string, bool, error) {
+	for i, s := range c.stores {
+		item, ttl, tier, ok, err := s.Get(key)
+		if err != nil {
+			c.reportError(fmt.Errorf("cache: chain store %d Get failed: %w", i, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		for _, higher := range c.stores[:i] {
+			go c.backfill(higher, key, item, ttl)
+		}
+
+		return item, ttl, tier, true, nil
+	}
+
+	// The key is absent from every store: either it was never cached here
+	// or its TTL has since elapsed in all of them. Either way it's no
+	// longer eligible for InvalidateByTag, so drop its tag membership
+	// rather than letting tagIndex hold a stale reference forever.
+	c.untrackTags(key)
+	return nil, 0, "", false, nil
+}
+
+// Set fans the write out to every store in the chain concurrently. Each
+// store individually gets up to FanoutTimeout to finish; a store that
+// blows past it is isolated via OnError and never blocks the others or Set
+// itself waiting past that same per-store deadline.
+func (c *Chain) Set(key string, item *Item, ttl time.Duration) error {
+	c.trackTags(key, item.Tags)
+
+	var wg sync.WaitGroup
+	for i, s := range c.stores {
+		wg.Add(1)
+		go func(i int, s Cacher) {
+			defer wg.Done()
+
+			done := make(chan error, 1)
+			go func() { done <- s.Set(key, item, ttl) }()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					c.reportError(fmt.Errorf("cache: chain store %d Set failed: %w", i, err))
+				}
+			case <-time.After(c.fanoutTimeout()):
+				c.reportError(fmt.Errorf("cache: chain store %d Set timed out after %s", i, c.fanoutTimeout()))
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Delete removes key from every store in the chain, isolating per-store
+// errors via OnError the same way Set does.
+func (c *Chain) Delete(key string) error {
+	c.untrackTags(key)
+
+	var wg sync.WaitGroup
+	for i, s := range c.stores {
+		wg.Add(1)
+		go func(i int, s Cacher) {
+			defer wg.Done()
+			if err := s.Delete(key); err != nil {
+				c.reportError(fmt.Errorf("cache: chain store %d Delete failed: %w", i, err))
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	return nil
+}
+
+// InvalidateByTag removes every entry that was Set with the given tag. Keys
+// are tracked in an in-memory index populated by Set, so this works even
+// when the underlying stores have no native tag support; stores that do
+// implement InvalidateByTag natively are also given the chance to flush
+// their own index.
+func (c *Chain) InvalidateByTag(tag string) error {
+	if keysI, ok := c.tagIndex.Load(tag); ok {
+		keys := keysI.(*sync.Map)
+		keys.Range(func(keyI, _ interface{}) bool {
+			c.Delete(keyI.(string))
+			return true
+		})
+		c.tagIndex.Delete(tag)
+	}
+
+	for i, s := range c.stores {
+		if err := s.InvalidateByTag(tag); err != nil {
+			c.reportError(fmt.Errorf("cache: chain store %d InvalidateByTag failed: %w", i, err))
+		}
+	}
+	return nil
+}
+
+// trackTags records that key was written with tags, so a later
+// InvalidateByTag can find it. It first drops key from whatever tags it was
+// previously recorded under, so re-Setting a key with a different tag set
+// doesn't leave it indexed under tags it's no longer stored with.
+func (c *Chain) trackTags(key string, tags []string) {
+	c.untrackTags(key)
+	if len(tags) == 0 {
+		return
+	}
+
+	c.keyTags.Store(key, tags)
+	for _, tag := range tags {
+		keysI, _ := c.tagIndex.LoadOrStore(tag, &sync.Map{})
+		keysI.(*sync.Map).Store(key, struct{}{})
+	}
+}
+
+// untrackTags removes key from every tag set it's currently a member of per
+// keyTags, pruning a tag set from tagIndex entirely once it's empty so the
+// index doesn't grow unbounded under churn.
+func (c *Chain) untrackTags(key string) {
+	tagsI, ok := c.keyTags.Load(key)
+	if !ok {
+		return
+	}
+	c.keyTags.Delete(key)
+
+	for _, tag := range tagsI.([]string) {
+		keysI, ok := c.tagIndex.Load(tag)
+		if !ok {
+			continue
+		}
+		keys := keysI.(*sync.Map)
+		keys.Delete(key)
+
+		empty := true
+		keys.Range(func(_, _ interface{}) bool {
+			empty = false
+			return false
+		})
+		if empty {
+			c.tagIndex.Delete(tag)
+		}
+	}
+}
+
+func (c *Chain) backfill(store Cacher, key string, item *Item, ttl time.Duration) {
+	if err := store.Set(key, item, ttl); err != nil {
+		c.reportError(fmt.Errorf("cache: chain back-fill failed: %w", err))
+	}
+}
+
+func (c *Chain) reportError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+func (c *Chain) fanoutTimeout() time.Duration {
+	if c.FanoutTimeout > 0 {
+		return c.FanoutTimeout
+	}
+	return defaultFanoutTimeout
+}
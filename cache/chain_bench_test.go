@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"database/sql/driver"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore wraps a Cacher and counts Get calls, standing in for an L2
+// such as Redis whose round trips are the thing a healthy L1 should spare
+// it from under load. latency simulates the network/IO cost a real L2
+// would add to every call.
+type countingStore struct {
+	inner   Cacher
+	latency time.Duration
+	gets    int64
+}
+
+func (s *countingStore) Get(key string) (*Item, time.Duration, string, bool, error) {
+	atomic.AddInt64(&s.gets, 1)
+	time.Sleep(s.latency)
+	return s.inner.Get(key)
+}
+
+func (s *countingStore) Set(key string, item *Item, ttl time.Duration) error {
+	return s.inner.Set(key, item, ttl)
+}
+
+func (s *countingStore) Delete(key string) error { return s.inner.Delete(key) }
+
+func (s *countingStore) InvalidateByTag(tag string) error { return s.inner.InvalidateByTag(tag) }
+
+// TestChain_L1ShortCircuitsL2UnderContention drives many concurrent Gets for
+// a key that's present in L1 and asserts the L2 is never consulted, even
+// under contention from many goroutines hitting the same hot key at once.
+func TestChain_L1ShortCircuitsL2UnderContention(t *testing.T) {
+	l1 := NewMemoryCache()
+	l2 := &countingStore{inner: NewMemoryCache(), latency: 5 * time.Millisecond}
+
+	item := &Item{Cols: []string{"id"}, Rows: [][]driver.Value{{int64(1)}}}
+	assert.NoError(t, l1.Set("hot", item, time.Minute))
+	assert.NoError(t, l2.Set("hot", item, time.Minute))
+
+	chain := NewChain(l1, l2)
+
+	const goroutines = 64
+	done := make(chan struct{}, goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			got, _, _, ok, err := chain.Get("hot")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, item, got)
+		}()
+	}
+	for i := 0; i < goroutines; i++ {
+		<-done
+	}
+
+	assert.Zero(t, atomic.LoadInt64(&l2.gets), "L2 must not be consulted while L1 holds the key")
+}
+
+// BenchmarkChain_Get compares Chain throughput when the hot key lives in L1
+// (short-circuiting a slow L2) against when only a slow L2 has it, under
+// GOMAXPROCS-wide contention on the same key.
+func BenchmarkChain_Get(b *testing.B) {
+	item := &Item{Cols: []string{"id"}, Rows: [][]driver.Value{{int64(1)}}}
+
+	b.Run("L1Hit", func(b *testing.B) {
+		l1 := NewMemoryCache()
+		l2 := &countingStore{inner: NewMemoryCache(), latency: 5 * time.Millisecond}
+		l1.Set("hot", item, time.Minute)
+		l2.Set("hot", item, time.Minute)
+		chain := NewChain(l1, l2)
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				chain.Get("hot")
+			}
+		})
+	})
+
+	b.Run("L2Only", func(b *testing.B) {
+		l1 := NewMemoryCache()
+		l2 := &countingStore{inner: NewMemoryCache(), latency: 5 * time.Millisecond}
+		l2.Set("hot", item, time.Minute)
+		chain := NewChain(l1, l2)
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				chain.Get("hot")
+			}
+		})
+	})
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	mu    sync.Mutex
+	items map[string]*Item
+	ttls  map[string]time.Duration
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{items: map[string]*Item{}, ttls: map[string]time.Duration{}}
+}
+
+func (f *fakeStore) Get(key string) (*Item, time.Duration, string, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	item, ok := f.items[key]
+	if !ok {
+		return nil, 0, "", false, nil
+	}
+	return item, f.ttls[key], "fakeStore", true, nil
+}
+
+func (f *fakeStore) Set(key string, item *Item, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items[key] = item
+	f.ttls[key] = ttl
+	return nil
+}
+
+func (f *fakeStore) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.items, key)
+	delete(f.ttls, key)
+	return nil
+}
+
+func (f *fakeStore) InvalidateByTag(tag string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, item := range f.items {
+		for _, t := range item.Tags {
+			if t == tag {
+				delete(f.items, key)
+				delete(f.ttls, key)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func TestChain_GetBackfillsHigherTiers(t *testing.T) {
+	l1 := newFakeStore()
+	l2 := newFakeStore()
+	item := &Item{Cols: []string{"id"}}
+	assert.NoError(t, l2.Set("k", item, time.Minute))
+
+	chain := NewChain(l1, l2)
+	got, ttl, _, ok, err := chain.Get("k")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, item, got)
+	assert.Equal(t, time.Minute, ttl)
+
+	assert.Eventually(t, func() bool {
+		_, _, _, ok, _ := l1.Get("k")
+		return ok
+	}, time.Second, time.Millisecond)
+}
+
+func TestChain_GetReturnsTheServingStoresTier(t *testing.T) {
+	l1 := NewMemoryCache()
+	l2 := newFakeStore()
+	assert.NoError(t, l2.Set("k", &Item{Cols: []string{"id"}}, time.Minute))
+
+	chain := NewChain(l1, l2)
+
+	_, _, tier, ok, err := chain.Get("k")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "fakeStore", tier, "L2 (fakeStore) served this hit, not L1")
+
+	assert.Eventually(t, func() bool {
+		_, _, _, ok, _ := l1.Get("k")
+		return ok
+	}, time.Second, time.Millisecond)
+
+	_, _, tier, ok, err = chain.Get("k")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, memoryCacheTier, tier, "once backfilled, L1 (MemoryCache) should serve the hit")
+}
+
+func TestChain_GetMissReturnsFalse(t *testing.T) {
+	chain := NewChain(newFakeStore(), newFakeStore())
+	_, _, _, ok, err := chain.Get("missing")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestChain_SetFansOutToAllStores(t *testing.T) {
+	l1 := newFakeStore()
+	l2 := newFakeStore()
+	chain := NewChain(l1, l2)
+
+	assert.NoError(t, chain.Set("k", &Item{}, time.Minute))
+	_, _, _, ok1, _ := l1.Get("k")
+	_, _, _, ok2, _ := l2.Get("k")
+	assert.True(t, ok1)
+	assert.True(t, ok2)
+}
+
+func TestChain_InvalidateByTagRemovesTaggedKeys(t *testing.T) {
+	l1 := newFakeStore()
+	chain := NewChain(l1)
+
+	assert.NoError(t, chain.Set("k1", &Item{Tags: []string{"rollup"}}, time.Minute))
+	assert.NoError(t, chain.Set("k2", &Item{Tags: []string{"other"}}, time.Minute))
+
+	assert.NoError(t, chain.InvalidateByTag("rollup"))
+
+	_, _, _, ok1, _ := l1.Get("k1")
+	_, _, _, ok2, _ := l1.Get("k2")
+	assert.False(t, ok1)
+	assert.True(t, ok2)
+}
+
+func tagIndexLen(c *Chain) int {
+	n := 0
+	c.tagIndex.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestChain_DeletePrunesTagIndex(t *testing.T) {
+	chain := NewChain(newFakeStore())
+	assert.NoError(t, chain.Set("k", &Item{Tags: []string{"rollup"}}, time.Minute))
+	assert.Equal(t, 1, tagIndexLen(chain))
+
+	assert.NoError(t, chain.Delete("k"))
+	assert.Equal(t, 0, tagIndexLen(chain), "tagIndex must not leak an entry for a deleted key")
+}
+
+func TestChain_GetMissPrunesTagIndexForExpiredKey(t *testing.T) {
+	chain := NewChain(newFakeStore())
+	assert.NoError(t, chain.Set("k", &Item{Tags: []string{"rollup"}}, time.Millisecond))
+
+	// Simulate the entry having expired out of every store without
+	// going through Chain.Delete.
+	for _, s := range chain.stores {
+		assert.NoError(t, s.Delete("k"))
+	}
+
+	_, _, _, ok, _ := chain.Get("k")
+	assert.False(t, ok)
+	assert.Equal(t, 0, tagIndexLen(chain), "a Get that finds the key nowhere must prune its stale tag entry")
+}
+
+func TestChain_SetWithDifferentTagsDropsOldTagMembership(t *testing.T) {
+	chain := NewChain(newFakeStore())
+	assert.NoError(t, chain.Set("k", &Item{Tags: []string{"a"}}, time.Minute))
+	assert.NoError(t, chain.Set("k", &Item{Tags: []string{"b"}}, time.Minute))
+
+	assert.NoError(t, chain.InvalidateByTag("a"))
+	_, _, _, ok, _ := chain.Get("k")
+	assert.True(t, ok, "k is no longer tagged 'a', invalidating it must not remove k")
+
+	assert.NoError(t, chain.InvalidateByTag("b"))
+	_, _, _, ok, _ = chain.Get("k")
+	assert.False(t, ok)
+}
+
+type erroringStore struct{}
+
+func (erroringStore) Get(key string) (*Item, time.Duration, string, bool, error) {
+	return nil, 0, "", false, fmt.Errorf("boom")
+}
+
+func (erroringStore) Set(key string, item *Item, ttl time.Duration) error {
+	return fmt.Errorf("boom")
+}
+
+func (erroringStore) Delete(key string) error {
+	return fmt.Errorf("boom")
+}
+
+func (erroringStore) InvalidateByTag(tag string) error {
+	return fmt.Errorf("boom")
+}
+
+func TestChain_SetIsolatesPerStoreErrors(t *testing.T) {
+	l1 := newFakeStore()
+	var errs []error
+	chain := &Chain{OnError: func(err error) { errs = append(errs, err) }}
+	chain.stores = []Cacher{erroringStore{}, l1}
+
+	assert.NoError(t, chain.Set("k", &Item{}, time.Minute))
+	_, _, _, ok, _ := l1.Get("k")
+	assert.True(t, ok)
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// zstdEncoder/zstdDecoder are shared across every ZstdCodec call. Both are
+// safe for concurrent use and reusing them avoids spinning up a fresh set of
+// zstd's internal worker goroutines on every Marshal/Unmarshal call.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// rawCompressor lets AdaptiveCodec hand a compressed Codec the raw msgpack
+// bytes it already computed while checking Threshold, instead of making the
+// Codec re-marshal the Item from scratch via the plain Marshal method.
+type rawCompressor interface {
+	compressRaw(raw []byte) []byte
+}
+
+// Codec controls how an Item is serialized before it is handed to a backend
+// store and deserialized when it is read back. Every implementation stamps
+// a one-byte header identifying itself, so a payload written under one
+// Codec can always be decoded later regardless of which Codec is currently
+// configured; see DecodeAny.
+type Codec interface {
+	Marshal(item *Item) ([]byte, error)
+	Unmarshal(data []byte, item *Item) error
+}
+
+// Codec header bytes, stamped as the first byte of every encoded payload.
+const (
+	codecMsgpack byte = iota
+	codecMsgpackSnappy
+	codecMsgpackZstd
+)
+
+// MsgpackCodec serializes items with msgpack and applies no compression. It
+// is the default Codec.
+type MsgpackCodec struct{}
+
+// Marshal implements Codec.
+func (MsgpackCodec) Marshal(item *Item) ([]byte, error) {
+	b, err := msgpack.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{codecMsgpack}, b...), nil
+}
+
+// Unmarshal implements Codec.
+func (MsgpackCodec) Unmarshal(data []byte, item *Item) error {
+	if err := checkHeader(data, codecMsgpack); err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(data[1:], item)
+}
+
+// SnappyCodec serializes items with msgpack and compresses the result with
+// snappy, a good fit for the large, repetitive row sets typical of
+// analytical queries.
+type SnappyCodec struct{}
+
+// Marshal implements Codec.
+func (c SnappyCodec) Marshal(item *Item) ([]byte, error) {
+	b, err := msgpack.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	return c.compressRaw(b), nil
+}
+
+func (SnappyCodec) compressRaw(raw []byte) []byte {
+	return append([]byte{codecMsgpackSnappy}, snappy.Encode(nil, raw)...)
+}
+
+// Unmarshal implements Codec.
+func (SnappyCodec) Unmarshal(data []byte, item *Item) error {
+	if err := checkHeader(data, codecMsgpackSnappy); err != nil {
+		return err
+	}
+	b, err := snappy.Decode(nil, data[1:])
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(b, item)
+}
+
+// ZstdCodec serializes items with msgpack and compresses the result with
+// zstd, trading more CPU than SnappyCodec for a smaller payload.
+type ZstdCodec struct{}
+
+// Marshal implements Codec.
+func (c ZstdCodec) Marshal(item *Item) ([]byte, error) {
+	b, err := msgpack.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	return c.compressRaw(b), nil
+}
+
+func (ZstdCodec) compressRaw(raw []byte) []byte {
+	return append([]byte{codecMsgpackZstd}, zstdEncoder.EncodeAll(raw, nil)...)
+}
+
+// Unmarshal implements Codec.
+func (ZstdCodec) Unmarshal(data []byte, item *Item) error {
+	if err := checkHeader(data, codecMsgpackZstd); err != nil {
+		return err
+	}
+	b, err := zstdDecoder.DecodeAll(data[1:], nil)
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(b, item)
+}
+
+// AdaptiveCodec only compresses payloads whose raw msgpack encoding is at
+// least Threshold bytes, falling back to MsgpackCodec below it so small
+// items don't pay the fixed cost of compression.
+type AdaptiveCodec struct {
+	Threshold  int
+	Compressed Codec
+}
+
+// defaultCompressThreshold is used when AdaptiveCodec.Threshold is left at
+// its zero value.
+const defaultCompressThreshold = 4 * 1024
+
+// NewAdaptiveCodec returns an AdaptiveCodec that compresses with compressed
+// once the raw msgpack encoding reaches threshold bytes. A threshold <= 0
+// defaults to 4KiB.
+func NewAdaptiveCodec(compressed Codec, threshold int) *AdaptiveCodec {
+	if threshold <= 0 {
+		threshold = defaultCompressThreshold
+	}
+	return &AdaptiveCodec{Threshold: threshold, Compressed: compressed}
+}
+
+// Marshal implements Codec.
+func (c *AdaptiveCodec) Marshal(item *Item) ([]byte, error) {
+	raw, err := msgpack.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	threshold := c.Threshold
+	if threshold <= 0 {
+		threshold = defaultCompressThreshold
+	}
+	if len(raw) < threshold {
+		return append([]byte{codecMsgpack}, raw...), nil
+	}
+	if rc, ok := c.Compressed.(rawCompressor); ok {
+		return rc.compressRaw(raw), nil
+	}
+	return c.Compressed.Marshal(item)
+}
+
+// Unmarshal implements Codec, dispatching on the header stamped by Marshal
+// so it transparently reads back both compressed and uncompressed entries.
+func (c *AdaptiveCodec) Unmarshal(data []byte, item *Item) error {
+	return DecodeAny(data, item)
+}
+
+// DecodeAny inspects the one-byte codec header stamped by Marshal and
+// dispatches to the matching Codec, so data written under an older
+// Config.Codec stays readable after the codec is changed.
+func DecodeAny(data []byte, item *Item) error {
+	if len(data) == 0 {
+		return fmt.Errorf("cache: empty payload")
+	}
+	switch data[0] {
+	case codecMsgpack:
+		return MsgpackCodec{}.Unmarshal(data, item)
+	case codecMsgpackSnappy:
+		return SnappyCodec{}.Unmarshal(data, item)
+	case codecMsgpackZstd:
+		return ZstdCodec{}.Unmarshal(data, item)
+	default:
+		return fmt.Errorf("cache: unknown codec header byte %d", data[0])
+	}
+}
+
+func checkHeader(data []byte, want byte) error {
+	if len(data) == 0 || data[0] != want {
+		return fmt.Errorf("cache: payload has wrong codec header")
+	}
+	return nil
+}
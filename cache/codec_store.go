@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// BytesStore is implemented by cache backends that store opaque byte
+// payloads rather than decoded Items, e.g. Redis's GET/SET or a Ristretto
+// instance keyed by the already-encoded entry. It is the storage seam
+// CodecCache serializes an Item through.
+type BytesStore interface {
+	Get(key string) (data []byte, ttl time.Duration, ok bool, err error)
+	Set(key string, data []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// CodecCache adapts a BytesStore into a Cacher, running every Item through
+// codec on Set and decoding it back with DecodeAny on Get. Because DecodeAny
+// dispatches on the header Marshal stamps, entries written under one Codec
+// stay readable after codec is swapped for another.
+//
+// CodecCache has no way to tell which keys in store were written under a
+// given tag without decoding every entry, so InvalidateByTag is a no-op;
+// compose CodecCache as a store inside Chain, which tracks tags itself, if
+// you need tag-based invalidation.
+type CodecCache struct {
+	store BytesStore
+	codec Codec
+}
+
+// NewCodecCache returns a Cacher that stores every Item in store, encoded
+// through codec.
+func NewCodecCache(store BytesStore, codec Codec) *CodecCache {
+	return &CodecCache{store: store, codec: codec}
+}
+
+// codecCacheTier is the tier label CodecCache reports from Get.
+const codecCacheTier = "cache.CodecCache"
+
+// Get implements Cacher.
+func (c *CodecCache) Get(key string) (*Item, time.Duration, string, bool, error) {
+	data, ttl, ok, err := c.store.Get(key)
+	if err != nil || !ok {
+		return nil, 0, "", ok, err
+	}
+	item := new(Item)
+	if err := DecodeAny(data, item); err != nil {
+		return nil, 0, "", false, err
+	}
+	return item, ttl, codecCacheTier, true, nil
+}
+
+// Set implements Cacher.
+func (c *CodecCache) Set(key string, item *Item, ttl time.Duration) error {
+	data, err := c.codec.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(key, data, ttl)
+}
+
+// Delete implements Cacher.
+func (c *CodecCache) Delete(key string) error {
+	return c.store.Delete(key)
+}
+
+// InvalidateByTag implements Cacher. See the CodecCache doc comment.
+func (c *CodecCache) InvalidateByTag(tag string) error {
+	return nil
+}
+
+// MemoryBytesStore is a minimal in-process BytesStore, standing in for a
+// byte-keyed backend such as Redis or Ristretto in trees (like this one)
+// that don't vendor a real one. Like Chain's test fakeStore, it records the
+// TTL it was given but doesn't evict on expiry itself.
+type MemoryBytesStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+}
+
+// NewMemoryBytesStore returns an empty MemoryBytesStore.
+func NewMemoryBytesStore() *MemoryBytesStore {
+	return &MemoryBytesStore{data: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+// Get implements BytesStore.
+func (m *MemoryBytesStore) Get(key string) ([]byte, time.Duration, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[key]
+	if !ok {
+		return nil, 0, false, nil
+	}
+	return data, m.ttls[key], true, nil
+}
+
+// Set implements BytesStore.
+func (m *MemoryBytesStore) Set(key string, data []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = data
+	m.ttls[key] = ttl
+	return nil
+}
+
+// Delete implements BytesStore.
+func (m *MemoryBytesStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	delete(m.ttls, key)
+	return nil
+}
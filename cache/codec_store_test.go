@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecCache_SetStoresEncodedBytesGetDecodesThemBack(t *testing.T) {
+	store := NewMemoryBytesStore()
+	c := NewCodecCache(store, SnappyCodec{})
+	item := sampleItem()
+
+	assert.NoError(t, c.Set("k", item, time.Minute))
+
+	data, ttl, ok, err := store.Get("k")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, ttl)
+	assert.Equal(t, codecMsgpackSnappy, data[0], "store must hold the codec-encoded payload, not the raw Item")
+
+	got, ttl, tier, ok, err := c.Get("k")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, ttl)
+	assert.Equal(t, item, got)
+	assert.Equal(t, codecCacheTier, tier)
+}
+
+func TestCodecCache_GetMissReturnsNotOK(t *testing.T) {
+	c := NewCodecCache(NewMemoryBytesStore(), MsgpackCodec{})
+	got, _, _, ok, err := c.Get("missing")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, got)
+}
+
+func TestCodecCache_DeleteRemovesEntry(t *testing.T) {
+	store := NewMemoryBytesStore()
+	c := NewCodecCache(store, MsgpackCodec{})
+	assert.NoError(t, c.Set("k", sampleItem(), time.Minute))
+	assert.NoError(t, c.Delete("k"))
+
+	_, _, _, ok, err := c.Get("k")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCodecCache_ReadsEntriesWrittenUnderADifferentCodec(t *testing.T) {
+	store := NewMemoryBytesStore()
+	item := sampleItem()
+	assert.NoError(t, NewCodecCache(store, ZstdCodec{}).Set("k", item, time.Minute))
+
+	got, _, _, ok, err := NewCodecCache(store, SnappyCodec{}).Get("k")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, item, got)
+}
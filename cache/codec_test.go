@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleItem() *Item {
+	return &Item{
+		Cols: []string{"id", "name"},
+		Rows: [][]driver.Value{
+			{int64(1), "alice"},
+			{int64(2), "bob"},
+		},
+		Tags: []string{"users"},
+	}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	codecs := map[string]Codec{
+		"msgpack":          MsgpackCodec{},
+		"msgpack+snappy":   SnappyCodec{},
+		"msgpack+zstd":     ZstdCodec{},
+		"adaptive (small)": NewAdaptiveCodec(SnappyCodec{}, 4096),
+		"adaptive (large)": NewAdaptiveCodec(SnappyCodec{}, 1),
+	}
+
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			item := sampleItem()
+			data, err := codec.Marshal(item)
+			assert.NoError(t, err)
+
+			var got Item
+			assert.NoError(t, codec.Unmarshal(data, &got))
+			assert.Equal(t, *item, got)
+		})
+	}
+}
+
+func TestDecodeAny_DispatchesOnHeaderRegardlessOfConfiguredCodec(t *testing.T) {
+	item := sampleItem()
+
+	for _, codec := range []Codec{MsgpackCodec{}, SnappyCodec{}, ZstdCodec{}} {
+		data, err := codec.Marshal(item)
+		assert.NoError(t, err)
+
+		var got Item
+		assert.NoError(t, DecodeAny(data, &got))
+		assert.Equal(t, *item, got)
+	}
+}
+
+func TestAdaptiveCodec_CompressesOnlyAboveThreshold(t *testing.T) {
+	small := &Item{Cols: []string{"id"}, Rows: [][]driver.Value{{int64(1)}}}
+	large := &Item{Cols: []string{"text"}, Rows: [][]driver.Value{{strings.Repeat("x", 8192)}}}
+
+	codec := NewAdaptiveCodec(SnappyCodec{}, 4096)
+
+	smallData, err := codec.Marshal(small)
+	assert.NoError(t, err)
+	assert.Equal(t, codecMsgpack, smallData[0])
+
+	largeData, err := codec.Marshal(large)
+	assert.NoError(t, err)
+	assert.Equal(t, codecMsgpackSnappy, largeData[0])
+}
+
+func TestDecodeAny_RejectsUnknownHeader(t *testing.T) {
+	var item Item
+	err := DecodeAny([]byte{0xFF}, &item)
+	assert.Error(t, err)
+}
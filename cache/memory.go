@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryEntry is a single MemoryCache slot, holding the absolute time the
+// entry expires at so Get can enforce TTL itself instead of only reporting
+// it, the way a real store like Redis would.
+type memoryEntry struct {
+	item      *Item
+	expiresAt time.Time
+}
+
+// MemoryCache is a Cacher backed by an in-process map with real TTL expiry,
+// suitable as the L1 tier in front of a shared L2 in a Chain. Unlike Chain's
+// test-only fakeStore, entries actually stop being served once their TTL
+// elapses, and tag membership is tracked per entry so InvalidateByTag works
+// natively without depending on Chain's own index.
+type MemoryCache struct {
+	mu   sync.RWMutex
+	data map[string]memoryEntry
+	tags map[string]map[string]struct{} // tag -> set of keys
+}
+
+// NewMemoryCache returns an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		data: map[string]memoryEntry{},
+		tags: map[string]map[string]struct{}{},
+	}
+}
+
+// memoryCacheTier is the tier label MemoryCache reports from Get.
+const memoryCacheTier = "cache.MemoryCache"
+
+// Get implements Cacher.
+func (m *MemoryCache) Get(key string) (*Item, time.Duration, string, bool, error) {
+	m.mu.RLock()
+	entry, ok := m.data[key]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, 0, "", false, nil
+	}
+
+	remaining := time.Until(entry.expiresAt)
+	if remaining <= 0 {
+		m.Delete(key)
+		return nil, 0, "", false, nil
+	}
+	return entry.item, remaining, memoryCacheTier, true, nil
+}
+
+// Set implements Cacher.
+func (m *MemoryCache) Set(key string, item *Item, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.untagLocked(key)
+	m.data[key] = memoryEntry{item: item, expiresAt: time.Now().Add(ttl)}
+	for _, tag := range item.Tags {
+		keys, ok := m.tags[tag]
+		if !ok {
+			keys = map[string]struct{}{}
+			m.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	return nil
+}
+
+// Delete implements Cacher.
+func (m *MemoryCache) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.untagLocked(key)
+	delete(m.data, key)
+	return nil
+}
+
+// InvalidateByTag implements Cacher.
+func (m *MemoryCache) InvalidateByTag(tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.tags[tag] {
+		m.untagLocked(key)
+		delete(m.data, key)
+	}
+	return nil
+}
+
+// untagLocked removes key from every tag set it's a member of. Callers must
+// hold m.mu.
+func (m *MemoryCache) untagLocked(key string) {
+	entry, ok := m.data[key]
+	if !ok {
+		return
+	}
+	for _, tag := range entry.item.Tags {
+		keys := m.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(m.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCache_SetGetRoundTrips(t *testing.T) {
+	m := NewMemoryCache()
+	item := sampleItem()
+	assert.NoError(t, m.Set("k", item, time.Minute))
+
+	got, ttl, tier, ok, err := m.Get("k")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, item, got)
+	assert.InDelta(t, time.Minute.Seconds(), ttl.Seconds(), 1)
+	assert.Equal(t, memoryCacheTier, tier)
+}
+
+func TestMemoryCache_GetExpiresEntriesPastTTL(t *testing.T) {
+	m := NewMemoryCache()
+	assert.NoError(t, m.Set("k", sampleItem(), time.Millisecond))
+
+	assert.Eventually(t, func() bool {
+		_, _, _, ok, _ := m.Get("k")
+		return !ok
+	}, time.Second, time.Millisecond)
+}
+
+func TestMemoryCache_DeleteRemovesEntryAndTags(t *testing.T) {
+	m := NewMemoryCache()
+	assert.NoError(t, m.Set("k", &Item{Tags: []string{"rollup"}}, time.Minute))
+	assert.NoError(t, m.Delete("k"))
+
+	_, _, _, ok, _ := m.Get("k")
+	assert.False(t, ok)
+	assert.Empty(t, m.tags, "Delete must drop k from its tag sets")
+	assert.NoError(t, m.InvalidateByTag("rollup"))
+}
+
+func TestMemoryCache_InvalidateByTagRemovesOnlyTaggedKeys(t *testing.T) {
+	m := NewMemoryCache()
+	assert.NoError(t, m.Set("k1", &Item{Tags: []string{"rollup"}}, time.Minute))
+	assert.NoError(t, m.Set("k2", &Item{Tags: []string{"other"}}, time.Minute))
+
+	assert.NoError(t, m.InvalidateByTag("rollup"))
+
+	_, _, _, ok1, _ := m.Get("k1")
+	_, _, _, ok2, _ := m.Get("k2")
+	assert.False(t, ok1)
+	assert.True(t, ok2)
+}
@@ -0,0 +1,29 @@
+package sqlcache
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/mitchellh/hashstructure"
+)
+
+// defaultHashFunc is the default Config.HashFunc. It combines the query text
+// and its bound arguments into a single cache key using hashstructure's FNV
+// hashing.
+func defaultHashFunc(query string, args []driver.NamedValue) (string, error) {
+	h, err := hashstructure.Hash(struct {
+		Query string
+		Args  []driver.NamedValue
+	}{query, args}, nil)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h), nil
+}
+
+// NoopHash can be used as Config.HashFunc when hash collisions are a concern;
+// it keys the cache on the raw query text and arguments instead of a hash
+// digest, at the cost of a longer, less uniform cache key.
+func NoopHash(query string, args []driver.NamedValue) (string, error) {
+	return fmt.Sprintf("%s|%v", query, args), nil
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/Kolo7/clickhouse-cache/cache"
+	"github.com/Kolo7/clickhouse-cache/metrics"
 	"github.com/ngrok/sqlmw"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Config is the configuration passed to NewInterceptor for creating new
@@ -16,7 +18,8 @@ import (
 type Config struct {
 	// Cache must be set to a type that implements the cache.Cacher interface
 	// which abstracts the backend cache implementation. This is a required
-	// field and cannot be nil.
+	// field and cannot be nil. Use cache.NewChain to compose several stores
+	// (e.g. an in-memory L1 in front of a shared Redis L2) into one Cacher.
 	Cache cache.Cacher
 	// OnError is called whenever methods of cache.Cacher interface or HashFunc
 	// returns error. Since sqlcache package does not log any failures, you can
@@ -26,16 +29,48 @@ type Config struct {
 	// default sqlcache uses mitchellh/hashstructure which internally uses FNV.
 	// If hash collision is a concern to you, consider using NoopHash.
 	HashFunc func(query string, args []driver.NamedValue) (string, error)
+	// SinglefightTimeout bounds how long a query waits to acquire the
+	// per-hash lock used to dedup concurrent identical queries. If the
+	// underlying conn.QueryContext for the in-flight query hangs, every
+	// other query for the same hash would otherwise block forever; once
+	// this timeout elapses they fall through to conn.QueryContext instead.
+	// Zero (the default) means no timeout beyond the query's own ctx.
+	SinglefightTimeout time.Duration
+	// MetricsRegisterer, if set, registers a sqlcache/metrics.Collectors
+	// against it and keeps it updated. Left nil (the default) sqlcache
+	// doesn't depend on or expose any Prometheus collectors.
+	MetricsRegisterer prometheus.Registerer
+	// MaxPreparedStmts bounds the number of distinct SQL texts whose
+	// prepared statement sqlcache keeps around for reuse across Prepare
+	// calls. Defaults to 1024 if zero.
+	MaxPreparedStmts int
+	// Codec controls how a cached cache.Item is sized for the
+	// sqlcache_rows_bytes metric (see Config.MetricsRegisterer). Defaults to
+	// cache.MsgpackCodec{}. Pass cache.NewAdaptiveCodec to only compress
+	// payloads over a size threshold, e.g. to match a Cacher backend that
+	// itself only compresses large payloads.
+	//
+	// Codec only sizes the metric; it does not itself compress what Cache
+	// stores, since cache.Cacher stores decoded Items, not bytes. To
+	// actually compress entries at rest, back Cache with a cache.CodecCache
+	// wrapping a byte-oriented store (see cache.NewCodecCache) configured
+	// with the same Codec, so the metric reflects what's really written.
+	Codec cache.Codec
 }
 
 // Interceptor is a ngrok/sqlmw interceptor that caches SQL queries and
 // their responses.
 type Interceptor struct {
-	c        cache.Cacher
-	hashFunc func(query string, args []driver.NamedValue) (string, error)
-	onErr    func(error)
-	stats    Stats
-	disabled bool
+	c                  cache.Cacher
+	hashFunc           func(query string, args []driver.NamedValue) (string, error)
+	onErr              func(error)
+	singlefightTimeout time.Duration
+	metrics            *metrics.Collectors
+	backend            string
+	stmtCache          *stmtLRU
+	codec              cache.Codec
+	stats              Stats
+	disabled           bool
 	sqlmw.NullInterceptor
 	KeyRWLock
 }
@@ -55,17 +90,62 @@ func NewInterceptor(config *Config) (*Interceptor, error) {
 		config.HashFunc = defaultHashFunc
 	}
 
+	if config.Codec == nil {
+		config.Codec = cache.MsgpackCodec{}
+	}
+
+	var collectors *metrics.Collectors
+	if config.MetricsRegisterer != nil {
+		var err error
+		collectors, err = metrics.New(config.MetricsRegisterer)
+		if err != nil {
+			return nil, fmt.Errorf("registering metrics: %w", err)
+		}
+	}
+
 	return &Interceptor{
-		config.Cache,
-		config.HashFunc,
-		config.OnError,
-		Stats{},
-		false,
-		sqlmw.NullInterceptor{},
-		KeyRWLock{},
+		c:                  config.Cache,
+		hashFunc:           config.HashFunc,
+		onErr:              config.OnError,
+		singlefightTimeout: config.SinglefightTimeout,
+		metrics:            collectors,
+		backend:            fmt.Sprintf("%T", config.Cache),
+		stmtCache:          newStmtLRU(config.MaxPreparedStmts),
+		codec:              config.Codec,
 	}, nil
 }
 
+// ConnPrepareContext intercepts database/sql's DB.PrepareContext/
+// Conn.PrepareContext calls, sharing a single underlying prepared statement
+// across concurrent and repeated Prepare calls for the same SQL text. The
+// returned driver.Stmt only proxies the base driver.Stmt surface, so a
+// driver's optional StmtQueryContext/StmtExecContext fast paths aren't
+// reachable through it.
+func (i *Interceptor) ConnPrepareContext(ctx context.Context, conn driver.ConnPrepareContext, query string) (context.Context, driver.Stmt, error) {
+	if i.disabled {
+		stmt, err := conn.PrepareContext(ctx, query)
+		return ctx, stmt, err
+	}
+
+	stmt, err := i.stmtCache.getOrPrepare(query, func() (driver.Stmt, error) {
+		return conn.PrepareContext(ctx, query)
+	})
+	if err != nil {
+		return ctx, nil, err
+	}
+	return ctx, stmt, nil
+}
+
+// lockCtx derives a child of ctx bounded by i.singlefightTimeout, to use when
+// acquiring the per-hash singleflight lock. If no timeout is configured it
+// returns ctx unchanged.
+func (i *Interceptor) lockCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.singlefightTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, i.singlefightTimeout)
+}
+
 // Driver returns the supplied driver.Driver with a new object that has
 // all of its calls intercepted by the sqlcache.Interceptor. Any DB call
 // without a context passed will not be intercepted.
@@ -109,10 +189,16 @@ func (i *Interceptor) StmtQueryContext(ctx context.Context, conn driver.StmtQuer
 		return ctx, rows, err
 	}
 	// 按hash值加锁，相同的hash值db查询同时只能有一个，拿到写锁之后再查一次cache，有值就返回，没有就查sql
-	// 进入加读锁
-	i.RLock(hash)
+	lockCtx, cancel := i.lockCtx(ctx)
+	defer cancel()
+
+	// 进入加读锁，带超时，避免上一个持有写锁的查询hang住导致这里永久阻塞
+	if err := i.RLockContext(lockCtx, hash); err != nil {
+		rows, err := conn.QueryContext(ctx, args)
+		return ctx, rows, err
+	}
 	// log.Printf("clickhouse-cache, 拿到读锁\n")
-	if cached := i.checkCache(hash); cached != nil {
+	if cached := i.checkCache(hash, attrs.tag); cached != nil {
 		// log.Printf("clickhouse-cache, 命中缓存\n")
 		i.RUnlock(hash)
 		// log.Printf("clickhouse-cache, 释放读锁\n")
@@ -122,13 +208,17 @@ func (i *Interceptor) StmtQueryContext(ctx context.Context, conn driver.StmtQuer
 	// 释放读锁，加写锁
 	i.RUnlock(hash)
 	// log.Printf("clickhouse-cache, 释放读锁\n")
-	i.Lock(hash)
+	waitStart := time.Now()
+	if err := i.LockContext(lockCtx, hash); err != nil {
+		rows, err := conn.QueryContext(ctx, args)
+		return ctx, rows, err
+	}
 	// log.Printf("clickhouse-cache, 拿到写锁\n")
 
-	// 读锁应该要有超时机制，如果超过一段时间没有解锁，要主动的去解锁，这里可能用锁无法实现了，要用协程同步工具
-
-	// 加写锁后，再读一次cache
-	if cached := i.checkCache(hash); cached != nil {
+	// 加写锁后，再读一次cache；如果这里命中，说明等待写锁期间有另一个相同hash
+	// 的查询帮我们把结果写进了cache（singleflight去重生效）
+	if cached := i.checkCache(hash, attrs.tag); cached != nil {
+		i.observeSinglefightWait(time.Since(waitStart))
 		// log.Printf("clickhouse-cache, 释放写锁\n")
 		i.Unlock(hash)
 		// log.Printf("clickhouse-cache, 命中缓存\n")
@@ -152,6 +242,8 @@ func (i *Interceptor) StmtQueryContext(ctx context.Context, conn driver.StmtQuer
 		}
 	}()
 	cacheSetter := func(item *cache.Item) {
+		item.Tags = attrs.tags
+		go i.observeRowsBytes(item)
 		err := i.c.Set(hash, item, time.Duration(attrs.ttl)*time.Second)
 		if err != nil {
 			atomic.AddUint64(&i.stats.Errors, 1)
@@ -189,16 +281,27 @@ func (i *Interceptor) ConnQueryContext(ctx context.Context, conn driver.QueryerC
 		rows, err := conn.QueryContext(ctx, query, args)
 		return ctx, rows, err
 	}
-	i.RLock(hash)
-	if cached := i.checkCache(hash); cached != nil {
+	lockCtx, cancel := i.lockCtx(ctx)
+	defer cancel()
+
+	if err := i.RLockContext(lockCtx, hash); err != nil {
+		rows, err = conn.QueryContext(ctx, query, args)
+		return ctx, rows, err
+	}
+	if cached := i.checkCache(hash, attrs.tag); cached != nil {
 		i.RUnlock(hash)
 		return ctx, cached, nil
 	}
 
 	i.RUnlock(hash)
-	i.Lock(hash)
+	waitStart := time.Now()
+	if err := i.LockContext(lockCtx, hash); err != nil {
+		rows, err = conn.QueryContext(ctx, query, args)
+		return ctx, rows, err
+	}
 
-	if cached := i.checkCache(hash); cached != nil {
+	if cached := i.checkCache(hash, attrs.tag); cached != nil {
+		i.observeSinglefightWait(time.Since(waitStart))
 		i.Unlock(hash)
 		return ctx, cached, nil
 	}
@@ -217,6 +320,8 @@ func (i *Interceptor) ConnQueryContext(ctx context.Context, conn driver.QueryerC
 		}
 	}()
 	cacheSetter := func(item *cache.Item) {
+		item.Tags = attrs.tags
+		go i.observeRowsBytes(item)
 		err := i.c.Set(hash, item, time.Duration(attrs.ttl)*time.Second)
 		if err != nil {
 			atomic.AddUint64(&i.stats.Errors, 1)
@@ -229,10 +334,61 @@ func (i *Interceptor) ConnQueryContext(ctx context.Context, conn driver.QueryerC
 	return ctx, newRowsRecorder(cacheSetter, rows, attrs.maxRows, done), err
 }
 
-func (i *Interceptor) checkCache(hash string) driver.Rows {
-	item, ok, err := i.c.Get(hash)
+// ConnExecContext intercepts database/sql's DB.ExecContext/Conn.ExecContext
+// calls, flushing any tags named in a "/* sqlcache invalidate=t1,t2 */" hint
+// once the write has completed successfully.
+func (i *Interceptor) ConnExecContext(ctx context.Context, conn driver.ExecerContext, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := conn.ExecContext(ctx, query, args)
+	if err == nil {
+		i.invalidateFromQuery(query)
+	}
+	return res, err
+}
+
+// StmtExecContext intercepts database/sql's stmt.ExecContext calls from a
+// prepared statement, flushing tags the same way ConnExecContext does.
+func (i *Interceptor) StmtExecContext(ctx context.Context, conn driver.StmtExecContext, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := conn.ExecContext(ctx, args)
+	if err == nil {
+		i.invalidateFromQuery(query)
+	}
+	return res, err
+}
+
+func (i *Interceptor) invalidateFromQuery(query string) {
+	attrs := getAttrs(query)
+	if attrs == nil || len(attrs.invalidate) == 0 {
+		return
+	}
+	if err := i.Invalidate(attrs.invalidate...); err != nil {
+		atomic.AddUint64(&i.stats.Errors, 1)
+		if i.onErr != nil {
+			i.onErr(fmt.Errorf("Cache.InvalidateByTag failed: %w", err))
+		}
+	}
+}
+
+// Invalidate flushes every cached entry stored under any of the given tags.
+// It is exposed so callers can invalidate programmatically in addition to
+// the "invalidate=" SQL comment hint.
+func (i *Interceptor) Invalidate(tags ...string) error {
+	for _, tag := range tags {
+		if err := i.c.InvalidateByTag(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Interceptor) checkCache(hash, queryTag string) driver.Rows {
+	i.updateLockMapSize()
+
+	item, _, tier, ok, err := i.c.Get(hash)
 	if err != nil {
 		atomic.AddUint64(&i.stats.Errors, 1)
+		if i.metrics != nil {
+			i.metrics.Errors.WithLabelValues(queryTag).Inc()
+		}
 		if i.onErr != nil {
 			i.onErr(fmt.Errorf("Cache.Get failed: %w", err))
 		}
@@ -241,9 +397,18 @@ func (i *Interceptor) checkCache(hash string) driver.Rows {
 
 	if !ok {
 		atomic.AddUint64(&i.stats.Misses, 1)
+		if i.metrics != nil {
+			i.metrics.Misses.WithLabelValues(queryTag).Inc()
+		}
 		return nil
 	}
 	atomic.AddUint64(&i.stats.Hits, 1)
+	if i.metrics != nil {
+		if tier == "" {
+			tier = i.backend
+		}
+		i.metrics.Hits.WithLabelValues(queryTag, tier).Inc()
+	}
 
 	return &rowsCached{
 		item,
@@ -251,6 +416,37 @@ func (i *Interceptor) checkCache(hash string) driver.Rows {
 	}
 }
 
+// observeSinglefightWait records how long a query waited on another
+// in-flight query for the same hash before reusing its cached result.
+func (i *Interceptor) observeSinglefightWait(d time.Duration) {
+	if i.metrics != nil {
+		i.metrics.SingleflightWait.Observe(d.Seconds())
+	}
+}
+
+// observeRowsBytes records the size item would occupy on the wire once
+// encoded with Config.Codec, i.e. what a cache.CodecCache-backed Cache (see
+// Config.Codec) actually stores; Cache itself stores the decoded Item, so
+// this is an estimate rather than the size of what Cache holds. Callers run
+// it in its own goroutine so the Codec encode it performs doesn't extend
+// how long a query holds the per-hash write lock.
+func (i *Interceptor) observeRowsBytes(item *cache.Item) {
+	if i.metrics == nil {
+		return
+	}
+	data, err := i.codec.Marshal(item)
+	if err != nil {
+		return
+	}
+	i.metrics.RowsBytes.Observe(float64(len(data)))
+}
+
+func (i *Interceptor) updateLockMapSize() {
+	if i.metrics != nil {
+		i.metrics.LockMapSize.Set(float64(i.KeyRWLock.Len()))
+	}
+}
+
 // Stats contains sqlcache statistics.
 type Stats struct {
 	Hits   uint64
@@ -1,6 +1,7 @@
 package sqlcache
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 )
@@ -10,45 +11,135 @@ import (
 */
 type timerRwMutex struct {
 	count int64
-	sync.RWMutex
+
+	rmu      sync.Mutex
+	readers  int64
+	writeTok chan struct{}
+}
+
+func newTimerRwMutex() *timerRwMutex {
+	t := &timerRwMutex{writeTok: make(chan struct{}, 1)}
+	t.writeTok <- struct{}{}
+	return t
+}
+
+// rLock acquires the read lock, blocking until ctx is done. Only the first
+// concurrent reader actually contends for writeTok; later readers ride along
+// once it has been acquired. rmu is held across the first reader's wait so
+// that readers arriving while a writer holds writeTok block behind it
+// instead of free-riding into a read lock the writer hasn't released yet.
+func (t *timerRwMutex) rLock(ctx context.Context) error {
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
+	if t.readers == 0 {
+		select {
+		case <-t.writeTok:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	t.readers++
+	return nil
+}
+
+func (t *timerRwMutex) rUnlock() {
+	t.rmu.Lock()
+	t.readers--
+	last := t.readers == 0
+	t.rmu.Unlock()
+	if last {
+		t.writeTok <- struct{}{}
+	}
 }
 
+// lock acquires the write lock, blocking until ctx is done.
+func (t *timerRwMutex) lock(ctx context.Context) error {
+	select {
+	case <-t.writeTok:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *timerRwMutex) unlock() {
+	t.writeTok <- struct{}{}
+}
+
+// KeyRWLock is a set of independent read/write locks keyed by an arbitrary
+// comparable value; a key's entry is evicted from the map as soon as its
+// last holder releases it.
 type KeyRWLock struct {
 	keyLock sync.Map
 }
 
-func (k *KeyRWLock) RLock(key interface{}) *sync.RWMutex {
+// RLock acquires a read lock for key, blocking until it is available.
+func (k *KeyRWLock) RLock(key interface{}) {
+	_ = k.RLockContext(context.Background(), key)
+}
+
+// RLockContext acquires a read lock for key, returning ctx.Err() if ctx is
+// done before the lock is acquired.
+func (k *KeyRWLock) RLockContext(ctx context.Context, key interface{}) error {
 	tRw, _ := k.getKeyLock(key)
-	// 指针对应的值加一，要确定加一之前是看到的值，count=-1代表锁已经从map移除了，用递归方式再次申请锁，如果是count已经被其他的协程修改过了再次重试。
-	// 成功加一后，就锁定了lock不会从map移除
 	for {
-		count := tRw.count
+		// 指针对应的值加一，要确定加一之前是看到的值，count=-1代表锁已经从map移除了，用递归方式再次申请锁，如果是count已经被其他的协程修改过了再次重试。
+		// 成功加一后，就锁定了lock不会从map移除
+		count := atomic.LoadInt64(&tRw.count)
 		if count == -1 {
-			return k.RLock(key)
+			return k.RLockContext(ctx, key)
 		}
-		if count != -1 && atomic.CompareAndSwapInt64(&tRw.count, count, count+1) {
-			tRw.RLock()
-			break
+		if atomic.CompareAndSwapInt64(&tRw.count, count, count+1) {
+			if err := tRw.rLock(ctx); err != nil {
+				k.release(tRw, key)
+				return err
+			}
+			return nil
 		}
 	}
-	return &tRw.RWMutex
 }
 
-func (k *KeyRWLock) Lock(key interface{}) *sync.RWMutex {
+// Lock acquires the write lock for key, blocking until it is available.
+func (k *KeyRWLock) Lock(key interface{}) {
+	_ = k.LockContext(context.Background(), key)
+}
+
+// LockContext acquires the write lock for key, returning ctx.Err() if ctx is
+// done before the lock is acquired.
+func (k *KeyRWLock) LockContext(ctx context.Context, key interface{}) error {
 	tRw, _ := k.getKeyLock(key)
 	for {
-		count := tRw.count
+		count := atomic.LoadInt64(&tRw.count)
+		if count == -1 {
+			return k.LockContext(ctx, key)
+		}
 		if atomic.CompareAndSwapInt64(&tRw.count, count, count+1) {
-			tRw.Lock()
-			break
+			if err := tRw.lock(ctx); err != nil {
+				k.release(tRw, key)
+				return err
+			}
+			return nil
 		}
 	}
-	return &tRw.RWMutex
 }
 
 func (k *KeyRWLock) RUnlock(key interface{}) {
 	tRw, _ := k.getKeyLock(key)
+	k.release(tRw, key)
+	tRw.rUnlock()
+}
+
+func (k *KeyRWLock) Unlock(key interface{}) {
+	tRw, _ := k.getKeyLock(key)
+	k.release(tRw, key)
+	tRw.unlock()
+}
 
+// release decrements the holder count for key and, if it just dropped to
+// zero, evicts the entry from keyLock so it can be garbage collected. It is
+// also used to unwind a holder slot claimed by RLockContext/LockContext that
+// then timed out before actually acquiring the lock.
+func (k *KeyRWLock) release(tRw *timerRwMutex, key interface{}) {
 	// tRw是不会减成负数的，最后一个会减为0
 	atomic.AddInt64(&tRw.count, -1)
 
@@ -57,24 +148,22 @@ func (k *KeyRWLock) RUnlock(key interface{}) {
 		// log.Printf("clickhouse-cache, 把锁从map清除:%s", key)
 		k.keyLock.Delete(key)
 	}
-	tRw.RUnlock()
 }
 
-func (k *KeyRWLock) Unlock(key interface{}) {
-	tRw, _ := k.getKeyLock(key)
-	atomic.AddInt64(&tRw.count, -1)
-	if atomic.CompareAndSwapInt64(&tRw.count, 0, -1) {
-		// log.Printf("clickhouse-cache, 把锁从map清除:%s", key)
-		k.keyLock.Delete(key)
-	}
-	tRw.Unlock()
+// Len returns the number of keys currently tracked by the lock map, i.e.
+// those with at least one active or waiting holder.
+func (k *KeyRWLock) Len() int {
+	n := 0
+	k.keyLock.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
 }
 
 func (k *KeyRWLock) getKeyLock(key interface{}) (*timerRwMutex, bool) {
-	tm := timerRwMutex{
-		count: 0,
-	}
-	mwMutexI, loaded := k.keyLock.LoadOrStore(key, &tm)
+	tm := newTimerRwMutex()
+	mwMutexI, loaded := k.keyLock.LoadOrStore(key, tm)
 	mwMutex := mwMutexI.(*timerRwMutex)
 	return mwMutex, loaded
 }
@@ -1,8 +1,13 @@
 package sqlcache
 
 import (
+	"context"
+	"errors"
 	"log"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestKeyRWLock_Lock(t *testing.T) {
@@ -32,3 +37,106 @@ func TestKeyRWLock_Lock(t *testing.T) {
 	lock.Unlock(2)
 	log.Printf("Unlock(2)")
 }
+
+func TestKeyRWLock_RLockContextTimesOutOnHeldKey(t *testing.T) {
+	lock := KeyRWLock{}
+	lock.Lock("k")
+	defer lock.Unlock("k")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := lock.RLockContext(ctx, "k")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestKeyRWLock_RLockContextBlocksBehindWriter(t *testing.T) {
+	lock := KeyRWLock{}
+	lock.Lock("k")
+
+	// First reader starts contending for the token the writer holds.
+	r1Done := make(chan struct{})
+	go func() {
+		lock.RLock("k")
+		close(r1Done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// A second, later reader must not free-ride in ahead of the writer.
+	r2Done := make(chan struct{})
+	go func() {
+		lock.RLock("k")
+		close(r2Done)
+	}()
+
+	select {
+	case <-r1Done:
+		t.Fatal("first reader acquired the lock before the writer released it")
+	case <-r2Done:
+		t.Fatal("second reader acquired the lock before the writer released it")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	lock.Unlock("k")
+
+	for _, done := range []chan struct{}{r1Done, r2Done} {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("reader never acquired the lock after the writer released it")
+		}
+	}
+	lock.RUnlock("k")
+	lock.RUnlock("k")
+}
+
+func TestKeyRWLock_LockContextSucceedsOnceReleased(t *testing.T) {
+	lock := KeyRWLock{}
+	lock.Lock("k")
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		lock.Unlock("k")
+		close(released)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := lock.LockContext(ctx, "k"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-released
+	lock.Unlock("k")
+}
+
+// TestKeyRWLock_LockContextNeverGrantsTwoWritersConcurrently stresses
+// Lock/Unlock on a single key from many goroutines so that, were
+// LockContext to revive an evicted timerRwMutex instead of retrying (the
+// count==-1 case RLockContext already guards against), two callers could
+// hold the write lock at once. A shared counter whose increments aren't
+// serialized by the lock would then race under -race or exceed 1.
+func TestKeyRWLock_LockContextNeverGrantsTwoWritersConcurrently(t *testing.T) {
+	lock := KeyRWLock{}
+	var holders int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				lock.Lock("k")
+				if n := atomic.AddInt64(&holders, 1); n != 1 {
+					t.Errorf("expected exactly 1 concurrent writer, got %d", n)
+				}
+				atomic.AddInt64(&holders, -1)
+				lock.Unlock("k")
+			}
+		}()
+	}
+	wg.Wait()
+}
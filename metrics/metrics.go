@@ -0,0 +1,58 @@
+// Package metrics provides an optional Prometheus exporter for
+// sqlcache.Interceptor, wired in via Config.MetricsRegisterer.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Collectors holds every Prometheus collector sqlcache registers when
+// Config.MetricsRegisterer is set.
+type Collectors struct {
+	Hits             *prometheus.CounterVec
+	Misses           *prometheus.CounterVec
+	Errors           *prometheus.CounterVec
+	SingleflightWait prometheus.Histogram
+	RowsBytes        prometheus.Histogram
+	LockMapSize      prometheus.Gauge
+}
+
+// New creates sqlcache's collectors and registers them against reg.
+func New(reg prometheus.Registerer) (*Collectors, error) {
+	c := &Collectors{
+		Hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sqlcache_cache_hits_total",
+			Help: "Total number of cache hits, labelled by query tag and backend.",
+		}, []string{"query_tag", "backend"}),
+		Misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sqlcache_cache_misses_total",
+			Help: "Total number of cache misses, labelled by query tag.",
+		}, []string{"query_tag"}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sqlcache_cache_errors_total",
+			Help: "Total number of cache Get errors, labelled by query tag. HashFunc, Set and invalidation errors are not counted.",
+		}, []string{"query_tag"}),
+		SingleflightWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "sqlcache_singleflight_wait_seconds",
+			Help:    "Time a query waited on another in-flight query for the same hash before reusing its result.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		RowsBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "sqlcache_rows_bytes",
+			Help:    "Size in bytes of row sets written to the cache.",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+		}),
+		LockMapSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "sqlcache_lock_map_size",
+			Help: "Number of keys currently tracked by the singleflight lock map.",
+		}),
+	}
+
+	for _, coll := range []prometheus.Collector{
+		c.Hits, c.Misses, c.Errors, c.SingleflightWait, c.RowsBytes, c.LockMapSize,
+	} {
+		if err := reg.Register(coll); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_RegistersCollectors(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c, err := New(reg)
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+
+	mfs, err := reg.Gather()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, mfs)
+}
+
+func TestNew_FailsOnDuplicateRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, err := New(reg)
+	assert.NoError(t, err)
+
+	_, err = New(reg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,32 @@
+package sqlcache
+
+import (
+	"database/sql/driver"
+	"io"
+
+	"github.com/Kolo7/clickhouse-cache/cache"
+)
+
+// rowsCached implements driver.Rows by replaying a previously cached
+// cache.Item.
+type rowsCached struct {
+	item *cache.Item
+	pos  int
+}
+
+func (r *rowsCached) Columns() []string {
+	return r.item.Cols
+}
+
+func (r *rowsCached) Close() error {
+	return nil
+}
+
+func (r *rowsCached) Next(dest []driver.Value) error {
+	if r.pos >= len(r.item.Rows) {
+		return io.EOF
+	}
+	copy(dest, r.item.Rows[r.pos])
+	r.pos++
+	return nil
+}
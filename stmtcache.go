@@ -0,0 +1,118 @@
+package sqlcache
+
+import (
+	"container/list"
+	"database/sql/driver"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultMaxPreparedStmts is used when Config.MaxPreparedStmts is left at
+// its zero value.
+const defaultMaxPreparedStmts = 1024
+
+// sharedStmt is a ref-counted decorator around a driver.Stmt so that
+// concurrent callers preparing the same SQL text can share one underlying
+// prepared statement instead of each round-tripping a PREPARE to the
+// database. The stmtLRU holds one ref for as long as the entry stays
+// cached; every caller that receives a sharedStmt via getOrPrepare holds
+// another, released when they Close it.
+type sharedStmt struct {
+	driver.Stmt
+	refs int64
+}
+
+func (s *sharedStmt) acquire() *sharedStmt {
+	atomic.AddInt64(&s.refs, 1)
+	return s
+}
+
+// Close releases the caller's ref, closing the underlying statement once
+// the last ref (caller or stmtLRU) has let go of it.
+func (s *sharedStmt) Close() error {
+	if atomic.AddInt64(&s.refs, -1) == 0 {
+		return s.Stmt.Close()
+	}
+	return nil
+}
+
+// stmtLRU is a size-bounded, ref-counted cache of prepared statements keyed
+// by SQL text. Concurrent Prepare calls for the same SQL text are deduped
+// via a per-key singleflight lock.
+type stmtLRU struct {
+	maxSize  int
+	prepare  KeyRWLock
+	mu       sync.Mutex
+	ll       *list.List
+	elements map[string]*list.Element
+}
+
+type stmtLRUEntry struct {
+	query string
+	stmt  *sharedStmt
+}
+
+func newStmtLRU(maxSize int) *stmtLRU {
+	if maxSize <= 0 {
+		maxSize = defaultMaxPreparedStmts
+	}
+	return &stmtLRU{
+		maxSize:  maxSize,
+		ll:       list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// getOrPrepare returns a shared, ref-counted statement for query, calling
+// prepareFn to prepare it only if it isn't already cached. Concurrent
+// callers for the same query dedup onto a single prepareFn call.
+func (c *stmtLRU) getOrPrepare(query string, prepareFn func() (driver.Stmt, error)) (*sharedStmt, error) {
+	c.prepare.Lock(query)
+	defer c.prepare.Unlock(query)
+
+	c.mu.Lock()
+	if el, ok := c.elements[query]; ok {
+		c.ll.MoveToFront(el)
+		shared := el.Value.(*stmtLRUEntry).stmt.acquire()
+		c.mu.Unlock()
+		return shared, nil
+	}
+	c.mu.Unlock()
+
+	stmt, err := prepareFn()
+	if err != nil {
+		return nil, err
+	}
+	shared := &sharedStmt{Stmt: stmt, refs: 1}
+
+	c.mu.Lock()
+	c.elements[query] = c.ll.PushFront(&stmtLRUEntry{query: query, stmt: shared})
+	c.evictLocked()
+	c.mu.Unlock()
+
+	return shared.acquire(), nil
+}
+
+// evictLocked drops the least recently used entries until the cache is back
+// at maxSize. Callers must hold c.mu.
+func (c *stmtLRU) evictLocked() {
+	for c.ll.Len() > c.maxSize {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			return
+		}
+		entry := oldest.Value.(*stmtLRUEntry)
+		c.ll.Remove(oldest)
+		delete(c.elements, entry.query)
+		// Drop the LRU's own ref; the underlying Stmt only actually closes
+		// once every caller currently holding a copy has released theirs.
+		entry.stmt.Close()
+	}
+}
+
+// Len reports how many distinct SQL texts are currently cached.
+func (c *stmtLRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,82 @@
+package sqlcache
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStmt struct {
+	driver.Stmt
+	closed bool
+}
+
+func (s *fakeStmt) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int { return 0 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, nil }
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return nil, nil }
+
+func TestStmtLRU_DedupsPrepareForSameQuery(t *testing.T) {
+	c := newStmtLRU(10)
+	prepareCalls := 0
+	prepare := func() (driver.Stmt, error) {
+		prepareCalls++
+		return &fakeStmt{}, nil
+	}
+
+	s1, err := c.getOrPrepare("select 1", prepare)
+	assert.NoError(t, err)
+	s2, err := c.getOrPrepare("select 1", prepare)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, prepareCalls)
+	assert.Same(t, s1.Stmt, s2.Stmt)
+}
+
+func TestStmtLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newStmtLRU(1)
+	prepare := func(n int) func() (driver.Stmt, error) {
+		return func() (driver.Stmt, error) { return &fakeStmt{}, nil }
+	}
+
+	first, err := c.getOrPrepare("select 1", prepare(1))
+	assert.NoError(t, err)
+	assert.NoError(t, first.Close())
+
+	_, err = c.getOrPrepare("select 2", prepare(2))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, c.Len())
+	assert.True(t, first.Stmt.(*fakeStmt).closed)
+}
+
+func TestStmtLRU_DoesNotCloseUnderlyingStmtWhileCallerHoldsRef(t *testing.T) {
+	c := newStmtLRU(1)
+	underlying := &fakeStmt{}
+	shared, err := c.getOrPrepare("select 1", func() (driver.Stmt, error) { return underlying, nil })
+	assert.NoError(t, err)
+
+	// Evict it from the LRU while the caller is still holding their ref.
+	_, err = c.getOrPrepare("select 2", func() (driver.Stmt, error) { return &fakeStmt{}, nil })
+	assert.NoError(t, err)
+	assert.False(t, underlying.closed, "underlying stmt must stay open while a caller still holds it")
+
+	assert.NoError(t, shared.Close())
+	assert.True(t, underlying.closed)
+}
+
+func TestStmtLRU_PropagatesPrepareError(t *testing.T) {
+	c := newStmtLRU(10)
+	_, err := c.getOrPrepare("select 1", func() (driver.Stmt, error) {
+		return nil, fmt.Errorf("boom")
+	})
+	assert.Error(t, err)
+}